@@ -0,0 +1,182 @@
+package listmap
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Record kinds used in the binary batch format.
+const (
+	batchRecordPut    byte = 1
+	batchRecordDelete byte = 2
+
+	// batchHeaderLength is the size of the fixed batch header:
+	// an 8-byte sequence number followed by a 4-byte record count.
+	batchHeaderLength = 8 + 4
+)
+
+// ErrBatchCorrupted is returned when a batch's encoded
+// representation can't be parsed.
+var ErrBatchCorrupted = errors.New("listmap: corrupted batch")
+
+// Batch is a sequence of Put and Delete operations that can be
+// applied to a Listmap atomically with Listmap.Write. Its binary
+// layout is modeled after LevelDB's write batch: an 8-byte sequence
+// number, a 4-byte record count, and then one variable-length record
+// per operation: [kind:1][keylen:uvarint][key][vallen:uvarint][value].
+// A Delete record omits its value.
+type Batch struct {
+	seq uint64
+	n   int
+	rep []byte
+}
+
+// NewBatch returns a pointer to an initialized, empty Batch.
+func NewBatch() *Batch {
+	b := &Batch{}
+	b.Reset()
+	return b
+}
+
+// Reset clears a Batch so it can be reused.
+func (b *Batch) Reset() {
+	b.n = 0
+	b.rep = make([]byte, batchHeaderLength)
+	binary.LittleEndian.PutUint64(b.rep[0:8], b.seq)
+	binary.LittleEndian.PutUint32(b.rep[8:12], 0)
+}
+
+// Len returns the number of records buffered in the Batch.
+func (b *Batch) Len() int {
+	return b.n
+}
+
+// Put buffers a Put operation for key and value.
+func (b *Batch) Put(key, value []byte) {
+	b.rep = append(b.rep, batchRecordPut)
+	b.rep = appendUvarintBytes(b.rep, key)
+	b.rep = appendUvarintBytes(b.rep, value)
+	b.n++
+	binary.LittleEndian.PutUint32(b.rep[8:12], uint32(b.n))
+}
+
+// Delete buffers a Delete operation for key.
+func (b *Batch) Delete(key []byte) {
+	b.rep = append(b.rep, batchRecordDelete)
+	b.rep = appendUvarintBytes(b.rep, key)
+	b.n++
+	binary.LittleEndian.PutUint32(b.rep[8:12], uint32(b.n))
+}
+
+// Dump returns a copy of the Batch's binary representation, suitable
+// for shipping over a network or storing for later replay with Load.
+func (b *Batch) Dump() []byte {
+	buf := make([]byte, len(b.rep))
+	copy(buf, b.rep)
+	return buf
+}
+
+// Load replaces the Batch's contents with data previously
+// produced by Dump.
+func (b *Batch) Load(data []byte) error {
+	if len(data) < batchHeaderLength {
+		return ErrBatchCorrupted
+	}
+
+	rep := make([]byte, len(data))
+	copy(rep, data)
+
+	b.seq = binary.LittleEndian.Uint64(rep[0:8])
+	b.n = int(binary.LittleEndian.Uint32(rep[8:12]))
+	b.rep = rep
+	return nil
+}
+
+// BatchHandler receives the operations buffered in a Batch when it
+// is replayed.
+type BatchHandler interface {
+	Put(key, value []byte)
+	Delete(key []byte)
+}
+
+// Replay calls handler for each operation buffered in the Batch, in
+// the order they were added.
+func (b *Batch) Replay(handler BatchHandler) error {
+	_, err := b.decode(func(kind byte, key, value []byte) {
+		switch kind {
+		case batchRecordPut:
+			handler.Put(key, value)
+		case batchRecordDelete:
+			handler.Delete(key)
+		}
+	})
+	return err
+}
+
+// batchOp is a single decoded batch record.
+type batchOp struct {
+	kind  byte
+	key   []byte
+	value []byte
+}
+
+// decode walks the Batch's binary representation, calling fn for
+// each record, and also returns the records as a slice for callers
+// that need random access (e.g. Listmap.Write).
+func (b *Batch) decode(fn func(kind byte, key, value []byte)) ([]batchOp, error) {
+	ops := make([]batchOp, 0, b.n)
+	data := b.rep[batchHeaderLength:]
+
+	for i := 0; i < b.n; i++ {
+		if len(data) < 1 {
+			return nil, ErrBatchCorrupted
+		}
+		kind := data[0]
+		data = data[1:]
+
+		key, rest, err := readUvarintBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+
+		var value []byte
+		if kind == batchRecordPut {
+			value, rest, err = readUvarintBytes(data)
+			if err != nil {
+				return nil, err
+			}
+			data = rest
+		}
+
+		if fn != nil {
+			fn(kind, key, value)
+		}
+		ops = append(ops, batchOp{kind: kind, key: key, value: value})
+	}
+
+	return ops, nil
+}
+
+// appendUvarintBytes appends a length-prefixed byte slice to buf.
+func appendUvarintBytes(buf, b []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	buf = append(buf, lenBuf[:n]...)
+	buf = append(buf, b...)
+	return buf
+}
+
+// readUvarintBytes reads a length-prefixed byte slice from the front
+// of buf, returning the slice and the remainder of buf.
+func readUvarintBytes(buf []byte) (b, rest []byte, err error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, nil, ErrBatchCorrupted
+	}
+	buf = buf[n:]
+	if uint64(len(buf)) < length {
+		return nil, nil, ErrBatchCorrupted
+	}
+	return buf[:length], buf[length:], nil
+}
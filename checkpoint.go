@@ -0,0 +1,122 @@
+package listmap
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Sync flushes the Listmap's write-ahead log to disk. It has no
+// effect if the Listmap wasn't opened with a write-ahead log (see
+// Options.SyncWrites, which does this automatically after every
+// write instead).
+func (l *Listmap) Sync() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.wal == nil {
+		return nil
+	}
+	return l.wal.sync()
+}
+
+// Checkpoint flushes the mapped region to disk and truncates the
+// write-ahead log: every mutation logged so far is now durable in
+// the main file, so replaying the log again on the next OpenListmap
+// would be redundant. It has no effect if the Listmap wasn't opened
+// with a write-ahead log.
+//
+// Checkpoint only protects against crashes after it returns; a crash
+// between a Set/Remove/Write call and the next Checkpoint is still
+// recovered from by replaying the write-ahead log, not by this call.
+func (l *Listmap) Checkpoint() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.wal == nil {
+		return nil
+	}
+
+	if err := msync(l.mapped); err != nil {
+		return err
+	}
+
+	return l.wal.truncate()
+}
+
+// msync flushes a memory-mapped region's dirty pages to the backing
+// file, blocking until the write completes.
+func msync(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC,
+		uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), uintptr(syscall.MS_SYNC))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// maxAppliedSeqLocked walks the list and returns the highest sequence
+// number attached to any record, whether as an insertion (seq) or a
+// removal (removedSeq). Every WAL entry at or below it is already
+// reflected in the mapped region. Callers must hold l.lock.
+func (l *Listmap) maxAppliedSeqLocked() uint64 {
+	var max uint64
+	for index := l.root.first; index != 0; {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		if r.seq > max {
+			max = r.seq
+		}
+		if r.removedSeq > max {
+			max = r.removedSeq
+		}
+		index = r.next
+	}
+	return max
+}
+
+// replayWAL re-applies any write-ahead log entry not yet reflected
+// in the mapped region, then truncates the log. It's called once by
+// OpenListmapWithOptions, before the Listmap is handed back to the
+// caller.
+//
+// This only recovers from a crash between a WAL write and the
+// corresponding mutation of the mapped region; it can't, on its own,
+// guarantee the mapped region's own writes already reached disk. A
+// Checkpoint (or exiting via SyncWrites) is what makes that durable.
+func (l *Listmap) replayWAL() error {
+	entries, err := readWAL(l.file.Name())
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	applied := l.maxAppliedSeqLocked()
+
+	for _, e := range entries {
+		if e.seq > l.root.seq {
+			l.root.seq = e.seq
+		}
+		if e.seq <= applied {
+			continue
+		}
+
+		switch e.kind {
+		case walEntryPut:
+			err = l.setLocked(e.key, e.value, e.seq, true)
+		case walEntryDelete:
+			err = l.removeLocked(e.key, e.seq, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return l.wal.truncate()
+}
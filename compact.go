@@ -0,0 +1,239 @@
+package listmap
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// autoCompactCheckInterval is how often the background goroutine
+// started for Options.AutoCompactRatio re-checks Stats.
+const autoCompactCheckInterval = time.Second
+
+// Stats describes the space usage of a Listmap's backing file.
+type Stats struct {
+	// LiveBytes is the space used by records that are neither
+	// removed nor superseded.
+	LiveBytes int64
+	// DeadBytes is the space used by tombstoned records.
+	DeadBytes int64
+	// RecordCount is the total number of records, live or dead.
+	RecordCount int64
+	// TombstoneCount is the number of removed records.
+	TombstoneCount int64
+}
+
+// Stats walks the Listmap and reports its current space usage. Set,
+// Remove, and Write always append, and Remove only flips a tombstone
+// bit, so DeadBytes and TombstoneCount only grow until Compact is
+// called.
+func (l *Listmap) Stats() Stats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var stats Stats
+	for index := l.root.first; index != 0; {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		size := int64(recordLength) + int64(r.keylen) + int64(r.vallen)
+
+		stats.RecordCount++
+		if r.isRemoved() {
+			stats.TombstoneCount++
+			stats.DeadBytes += size
+		} else {
+			stats.LiveBytes += size
+		}
+
+		index = r.next
+	}
+	return stats
+}
+
+// Compact rewrites the Listmap's backing file in place, dropping
+// tombstoned records, unless a live Snapshot may still need to see
+// them: a record removed after the oldest live Snapshot was taken is
+// kept. It walks the linked list once, in key order, streaming surviving
+// records into a fresh sibling file, then atomically renames that
+// file over the original and re-mmaps it.
+//
+// Existing Cursors, including those made through a Snapshot, are
+// never left holding a pointer into unmapped memory: the mapping Compact replaces is retired rather
+// than released, so it stays valid for as long as anything made
+// before this call might still read through it. Such readers simply
+// continue to observe the Listmap as it was just before this Compact.
+func (l *Listmap) Compact() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	oldestSeq, hasSnapshot := l.oldestSnapshotSeq()
+
+	type survivor struct {
+		key, value []byte
+		seq        uint64
+		removedSeq uint64
+		flags      uint8
+	}
+
+	var survivors []survivor
+	for index := l.root.first; index != 0; {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		keyStart := int(index) + int(recordLength)
+		valStart := keyStart + int(r.keylen)
+		key := l.mapped[keyStart:valStart]
+		value := l.mapped[valStart : valStart+int(r.vallen)]
+
+		if !r.isRemoved() || (hasSnapshot && r.removedSeq > oldestSeq) {
+			survivors = append(survivors, survivor{
+				key:        append([]byte(nil), key...),
+				value:      append([]byte(nil), value...),
+				seq:        r.seq,
+				removedSeq: r.removedSeq,
+				flags:      r.flags,
+			})
+		}
+
+		index = r.next
+	}
+
+	size := int64(rootLength)
+	for _, s := range survivors {
+		size += int64(recordLength) + int64(len(s.key)) + int64(len(s.value))
+	}
+	fileSize := size
+	if fileSize < constTruncateResize {
+		fileSize = constTruncateResize
+	}
+
+	path := l.file.Name()
+	tmpPath := path + ".compact"
+
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Truncate(fileSize); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	newMapped, err := syscall.Mmap(int(tmp.Fd()), 0, int(fileSize),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	newRoot := (*root)(unsafe.Pointer(&newMapped[0]))
+	newRoot.version = l.root.version
+	newRoot.comparerNameLen = l.root.comparerNameLen
+	newRoot.comparerName = l.root.comparerName
+	newRoot.seq = l.root.seq
+	newRoot.compression = l.root.compression
+
+	offset := uint64(rootLength)
+	prev := uint64(0)
+	for i, s := range survivors {
+		r := (*record)(unsafe.Pointer(&newMapped[offset]))
+		r.keylen = uint16(len(s.key))
+		r.vallen = uint16(len(s.value))
+		r.seq = s.seq
+		r.removedSeq = s.removedSeq
+		r.flags = s.flags
+		r.prev = prev
+		copy(newMapped[offset+uint64(recordLength):], append(append([]byte(nil), s.key...), s.value...))
+
+		if i == 0 {
+			newRoot.first = offset
+		}
+		if prev != 0 {
+			(*record)(unsafe.Pointer(&newMapped[prev])).next = offset
+		}
+
+		prev = offset
+		offset += uint64(recordLength) + uint64(len(s.key)) + uint64(len(s.value))
+	}
+	newRoot.last = prev
+	newRoot.lastInserted = prev
+
+	syscall.Munmap(newMapped)
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// l.file/l.mapped are left untouched until the rewritten file is
+	// reopened and remapped: if either of the next two steps fails,
+	// the Listmap must still be usable against its pre-Compact state
+	// rather than left pointing at a closed file or an unmapped
+	// region.
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+
+	mapped, err := syscall.Mmap(int(f.Fd()), 0, int(fileSize),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// A Cursor or Snapshot obtained before this Compact may still be
+	// reading through l.file/l.mapped via a raw pointer, without
+	// holding l.lock for its whole lifetime, so the old file and
+	// mapping are retired rather than closed/unmapped here (see
+	// retireMapping).
+	l.retireMapping(l.file, l.mapped)
+
+	l.file = f
+	l.mapped = mapped
+	l.fileSize = fileSize
+	l.root = (*root)(unsafe.Pointer(&l.mapped[0]))
+	l.invalidateSample()
+
+	return nil
+}
+
+// autoCompactLoop periodically checks Stats against
+// Options.AutoCompactRatio, triggering a Compact when the fraction of
+// dead bytes reaches the configured threshold. It mirrors the
+// compaction trigger used by LSM-style stores, and runs until
+// stopAutoCompact is closed by Close or Destroy.
+func (l *Listmap) autoCompactLoop() {
+	ticker := time.NewTicker(autoCompactCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopAutoCompact:
+			return
+		case <-ticker.C:
+			stats := l.Stats()
+			total := stats.LiveBytes + stats.DeadBytes
+			if total == 0 {
+				continue
+			}
+			if float64(stats.DeadBytes)/float64(total) >= l.autoCompactRatio {
+				l.Compact()
+			}
+		}
+	}
+}
+
+// startAutoCompact starts the background auto-compaction goroutine
+// if opts enables it.
+func (l *Listmap) startAutoCompact(opts *Options) {
+	if opts == nil || opts.AutoCompactRatio <= 0 {
+		return
+	}
+
+	l.autoCompactRatio = opts.AutoCompactRatio
+	l.stopAutoCompact = make(chan struct{})
+	go l.autoCompactLoop()
+}
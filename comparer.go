@@ -0,0 +1,30 @@
+package listmap
+
+import "bytes"
+
+// Comparer defines a total order over keys, analogous to goleveldb's
+// comparer.Comparer. A Listmap routes every key comparison through
+// its configured Comparer, so a custom implementation can provide
+// reverse-lexicographic order, numeric ordering, or composite-key
+// schemes without forking the package.
+type Comparer interface {
+	// Compare returns a negative number, zero, or a positive number
+	// depending on whether a is less than, equal to, or greater
+	// than b.
+	Compare(a, b []byte) int
+
+	// Name returns the name of the comparer. It's persisted in the
+	// Listmap's root header, so a file can't silently be reopened
+	// with a comparer that orders keys differently.
+	Name() string
+}
+
+// DefaultComparer orders keys lexicographically by byte value, the
+// same order Listmap used before Comparer existed.
+var DefaultComparer Comparer = bytewiseComparer{}
+
+type bytewiseComparer struct{}
+
+func (bytewiseComparer) Compare(a, b []byte) int { return bytes.Compare(a, b) }
+
+func (bytewiseComparer) Name() string { return "listmap.BytewiseComparator" }
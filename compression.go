@@ -0,0 +1,33 @@
+package listmap
+
+import "github.com/golang/snappy"
+
+// Compression identifies the algorithm used to compress values
+// before they're written to the mapped region.
+type Compression uint8
+
+const (
+	// CompressionNone stores values as-is.
+	CompressionNone Compression = iota
+	// CompressionSnappy compresses values with Snappy.
+	CompressionSnappy
+)
+
+// compressValue compresses value according to c, or returns it
+// unchanged if c is CompressionNone.
+func compressValue(c Compression, value []byte) []byte {
+	if c != CompressionSnappy {
+		return value
+	}
+	return snappy.Encode(nil, value)
+}
+
+// decompressValue reverses compressValue. raw is returned unchanged
+// unless compressed is true, in which case it's decoded into a
+// freshly allocated slice. A non-nil error means raw is corrupt.
+func decompressValue(c Compression, raw []byte, compressed bool) ([]byte, error) {
+	if !compressed {
+		return raw, nil
+	}
+	return snappy.Decode(nil, raw)
+}
@@ -6,58 +6,110 @@ import (
 
 // Cursor represents a cursor in the map.
 type Cursor struct {
-	l     *Listmap
-	index int
-	r     *record
+	l        *Listmap
+	mapped   []byte
+	index    int
+	r        *record
+	snapshot *Snapshot
+	valid    bool
 }
 
-// NewCursor returns a pointer to a cursor
-// positioned at the first element of the Listmap.
+// NewCursor returns a pointer to a cursor positioned at the first
+// element of the Listmap, or nil if the Listmap is empty.
 func (l *Listmap) NewCursor() *Cursor {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.newCursorLocked()
+}
+
+// newCursorLocked is NewCursor without its own locking, for use by
+// callers that already hold l.lock (for reading or writing).
+func (l *Listmap) newCursorLocked() *Cursor {
+	if l.root.first == 0 {
+		return nil
+	}
 	return &Cursor{
-		l:     l,
-		index: int(l.root.first),
-		r:     (*record)(unsafe.Pointer(&l.mapped[int(l.root.first)])),
+		l:      l,
+		mapped: l.mapped,
+		index:  int(l.root.first),
+		r:      (*record)(unsafe.Pointer(&l.mapped[int(l.root.first)])),
+		valid:  true,
 	}
 }
 
-// seek is not exported because indices are not accessible to the user.
+// seek is not exported because indices are not accessible to the
+// user. Like the rest of Cursor's unexported methods, it assumes the
+// caller already holds c.l.lock, and reads through c.mapped (the
+// mapping the cursor was last positioned against) rather than
+// c.l.mapped, which may have moved on to a later grow or Compact
+// since.
 func (c *Cursor) seek(i int) *Cursor {
 	c.index = i
-	c.r = (*record)(unsafe.Pointer(&c.l.mapped[i]))
+	c.r = (*record)(unsafe.Pointer(&c.mapped[i]))
 	return c
 }
 
 // Next moves the cursor to the next element in
 // the Listmap and returns a pointer to itself or
 // nil if the end of the list is reached. This
-// modifies the original cursor.
+// modifies the original cursor. If the cursor was
+// created from a Snapshot, records not visible to
+// that Snapshot are skipped.
 func (c *Cursor) Next() *Cursor {
-	next := int(c.r.next)
-	if next == 0 {
-		return nil
-	}
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
 
-	c.index = next
-	c.r = (*record)(unsafe.Pointer(&c.l.mapped[next]))
+	return c.nextLocked()
+}
 
-	return c
+func (c *Cursor) nextLocked() *Cursor {
+	for {
+		next := int(c.r.next)
+		if next == 0 {
+			c.valid = false
+			return nil
+		}
+
+		c.index = next
+		c.r = (*record)(unsafe.Pointer(&c.mapped[next]))
+
+		if c.snapshot == nil || c.r.visibleAt(c.snapshot.seq) {
+			c.valid = true
+			return c
+		}
+	}
 }
 
 // Prev moves the cursor to the previous element in
 // the Listmap and returns a pointer to itself or
 // nil when moved behind the first element. This
-// modifies the original cursor.
+// modifies the original cursor. If the cursor was
+// created from a Snapshot, records not visible to
+// that Snapshot are skipped.
 func (c *Cursor) Prev() *Cursor {
-	prev := int(c.r.prev)
-	if prev == 0 {
-		return nil
-	}
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	return c.prevLocked()
+}
 
-	c.index = prev
-	c.r = (*record)(unsafe.Pointer(&c.l.mapped[prev]))
+func (c *Cursor) prevLocked() *Cursor {
+	for {
+		prev := int(c.r.prev)
+		if prev == 0 {
+			c.valid = false
+			return nil
+		}
 
-	return c
+		c.index = prev
+		c.r = (*record)(unsafe.Pointer(&c.mapped[prev]))
+
+		if c.snapshot == nil || c.r.visibleAt(c.snapshot.seq) {
+			c.valid = true
+			return c
+		}
+	}
 }
 
 // Key returns the key of the element at the current
@@ -65,17 +117,39 @@ func (c *Cursor) Prev() *Cursor {
 // of the memory-mapped file, so modifications may lead
 // to corruption of the list.
 func (c *Cursor) Key() []byte {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	return c.keyLocked()
+}
+
+func (c *Cursor) keyLocked() []byte {
 	start := c.index + int(recordLength)
 	end := start + int(c.r.keylen)
-	return c.l.mapped[start:end]
+	return c.mapped[start:end]
 }
 
-// Value returns the value of the element at the current
-// location of the cursor. The returned slice is a subslice
-// of the memory-mapped file, so modifications may lead
-// to corruption of the list.
+// Value returns the value of the element at the current location of
+// the cursor. When the Listmap has no Compression configured, the
+// returned slice is a subslice of the memory-mapped file, so
+// modifications may lead to corruption of the list. When compression
+// is enabled, the value is instead decompressed into a freshly
+// allocated slice.
 func (c *Cursor) Value() []byte {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	return c.valueLocked()
+}
+
+func (c *Cursor) valueLocked() []byte {
 	start := c.index + int(recordLength) + int(c.r.keylen)
 	end := start + int(c.r.vallen)
-	return c.l.mapped[start:end]
+	raw := c.mapped[start:end]
+
+	value, err := decompressValue(c.l.compression, raw, c.r.isCompressed())
+	if err != nil {
+		panic("listmap: corrupt compressed value: " + err.Error())
+	}
+	return value
 }
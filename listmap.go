@@ -2,19 +2,24 @@
 package listmap
 
 import (
-	"bytes"
 	"errors"
 	"os"
+	"sort"
 	"sync"
 	"syscall"
 	"unsafe"
 )
 
 var (
-	ErrKeyNotFound       = errors.New("listmap: key not found")
-	ErrKeyPresent        = errors.New("listmap: key already present")
-	ErrFileTruncateError = errors.New("listmap: file truncate error")
-	ErrUnknown           = errors.New("listmap: unknown error")
+	ErrKeyNotFound         = errors.New("listmap: key not found")
+	ErrKeyPresent          = errors.New("listmap: key already present")
+	ErrFileTruncateError   = errors.New("listmap: file truncate error")
+	ErrUnknown             = errors.New("listmap: unknown error")
+	ErrUnsupportedVersion  = errors.New("listmap: unsupported file version")
+	ErrComparerMismatch    = errors.New("listmap: file was created with a different comparer")
+	ErrComparerNameTooLong = errors.New("listmap: comparer name too long")
+	ErrKeyTooLarge         = errors.New("listmap: key too large")
+	ErrValueTooLarge       = errors.New("listmap: value too large")
 )
 
 const (
@@ -22,34 +27,129 @@ const (
 	recordLength = unsafe.Sizeof(record{})
 
 	constTruncateResize = 1 << 16
+
+	// listmapVersion is the on-disk format version written to the
+	// root header. It's bumped whenever the layout of root or
+	// record changes incompatibly.
+	listmapVersion = 3
+
+	// maxComparerNameLength is the largest Comparer.Name() that
+	// can be persisted in the root header.
+	maxComparerNameLength = 32
+
+	// maxRecordFieldLength is the largest a key or a (possibly
+	// compressed) value can be: record.keylen and record.vallen are
+	// both uint16, so anything longer would silently wrap and
+	// truncate on write.
+	maxRecordFieldLength = 1<<16 - 1
 )
 
 // Listmap represents an ordered doubly linked list map.
 type Listmap struct {
-	file     *os.File
-	fileSize int64
-	lock     *sync.Mutex
-	root     *root
-	mapped   []byte
+	file        *os.File
+	fileSize    int64
+	lock        *sync.RWMutex
+	root        *root
+	mapped      []byte
+	comparer    Comparer
+	compression Compression
+	wal         *wal
+
+	// retired holds every mapping (and, for a Compact, the file it
+	// backed) that l.mapped/l.file used to point at before a grow or
+	// a Compact replaced them. Cursors and Snapshots read through raw
+	// pointers into whichever mapping was live when they were made,
+	// without holding l.lock for their whole lifetime, so a replaced
+	// mapping is kept reachable here instead of being unmapped out
+	// from under them.
+	retired []retiredMapping
+
+	snapshotsMu sync.Mutex
+	snapshots   map[uint64]int
+
+	autoCompactRatio float64
+	stopAutoCompact  chan struct{}
+
+	sampleMu  sync.Mutex
+	sample    []sampleEntry
+	sampleOps int
+}
+
+// retiredMapping is a previously-live mapping (and, if it came from a
+// Compact rather than a grow, the file it backed) kept alive past the
+// point where the Listmap itself stopped using it.
+type retiredMapping struct {
+	file   *os.File
+	mapped []byte
+}
+
+// retireMapping keeps mapped (and, if non-nil, the file it backed)
+// reachable instead of releasing it immediately. Callers must hold
+// l.lock for writing.
+func (l *Listmap) retireMapping(file *os.File, mapped []byte) {
+	l.retired = append(l.retired, retiredMapping{file: file, mapped: mapped})
 }
 
 type root struct {
-	first        uint64
-	last         uint64
-	lastInserted uint64
+	version         uint32
+	comparerNameLen uint8
+	comparerName    [maxComparerNameLength]byte
+	first           uint64
+	last            uint64
+	lastInserted    uint64
+	seq             uint64
+	compression     uint8
 }
 
 type record struct {
-	prev    uint64
-	next    uint64
-	keylen  uint16
-	vallen  uint16
-	removed bool
+	prev       uint64
+	next       uint64
+	keylen     uint16
+	vallen     uint16
+	seq        uint64
+	removedSeq uint64
+	flags      uint8
+}
+
+// recordFlagCompressed marks a record whose value was compressed
+// with the Listmap's Compression before being written.
+const recordFlagCompressed = 1 << 0
+
+// isRemoved reports whether the record is currently marked removed,
+// ignoring any snapshot.
+func (r *record) isRemoved() bool {
+	return r.removedSeq != 0
+}
+
+// isCompressed reports whether the record's value was compressed
+// before being written.
+func (r *record) isCompressed() bool {
+	return r.flags&recordFlagCompressed != 0
+}
+
+// visibleAt reports whether the record should be visible to a
+// reader as of sequence number seq: it must have existed by seq and
+// not yet have been removed as of seq.
+func (r *record) visibleAt(seq uint64) bool {
+	return r.seq <= seq && (r.removedSeq == 0 || r.removedSeq > seq)
 }
 
 // NewListmap returns a pointer to an initialized list backed by file
 // or nil in the case of an error. file will be truncated.
 func NewListmap(file string) (*Listmap, error) {
+	return NewListmapWithOptions(file, nil)
+}
+
+// NewListmapWithOptions returns a pointer to an initialized list
+// backed by file, configured by opts, or nil in the case of an
+// error. file will be truncated. A nil opts is equivalent to
+// &Options{}.
+func NewListmapWithOptions(file string, opts *Options) (*Listmap, error) {
+	comparer := opts.comparer()
+	if len(comparer.Name()) > maxComparerNameLength {
+		return nil, ErrComparerNameTooLong
+	}
+
 	f, err := os.Create(file)
 	if err != nil {
 		return nil, err
@@ -71,19 +171,45 @@ func NewListmap(file string) (*Listmap, error) {
 	}
 
 	l := &Listmap{
-		file:     f,
-		lock:     &sync.Mutex{},
-		mapped:   sl,
-		fileSize: stat.Size(),
+		file:        f,
+		lock:        &sync.RWMutex{},
+		mapped:      sl,
+		fileSize:    stat.Size(),
+		comparer:    comparer,
+		compression: opts.compression(),
+		snapshots:   make(map[uint64]int),
 	}
 
 	l.root = (*root)(unsafe.Pointer(&l.mapped[0]))
+	l.root.version = listmapVersion
+	l.root.comparerNameLen = uint8(len(comparer.Name()))
+	copy(l.root.comparerName[:], comparer.Name())
+	l.root.compression = uint8(l.compression)
+
+	l.wal, err = openWAL(file, opts.syncWrites())
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	l.startAutoCompact(opts)
 	return l, nil
 }
 
 // OpenListmap returns a pointer to an existing Listmap
 // backed by file or nil in the case of an error.
 func OpenListmap(file string) (*Listmap, error) {
+	return OpenListmapWithOptions(file, nil)
+}
+
+// OpenListmapWithOptions returns a pointer to an existing Listmap
+// backed by file, configured by opts, or nil in the case of an
+// error. The comparer in opts must match the one the file was
+// created with, or ErrComparerMismatch is returned. A nil opts is
+// equivalent to &Options{}.
+func OpenListmapWithOptions(file string, opts *Options) (*Listmap, error) {
+	comparer := opts.comparer()
+
 	f, err := os.OpenFile(file, os.O_RDWR, 0666)
 	if err != nil {
 		return nil, err
@@ -103,50 +229,159 @@ func OpenListmap(file string) (*Listmap, error) {
 	}
 
 	l := &Listmap{
-		file:     f,
-		lock:     &sync.Mutex{},
-		mapped:   sl,
-		fileSize: stat.Size(),
+		file:      f,
+		lock:      &sync.RWMutex{},
+		mapped:    sl,
+		fileSize:  stat.Size(),
+		comparer:  comparer,
+		snapshots: make(map[uint64]int),
 	}
 
 	l.root = (*root)(unsafe.Pointer(&l.mapped[0]))
+
+	if l.root.version != listmapVersion {
+		l.Close()
+		return nil, ErrUnsupportedVersion
+	}
+
+	storedComparerName := string(l.root.comparerName[:l.root.comparerNameLen])
+	if storedComparerName != comparer.Name() {
+		l.Close()
+		return nil, ErrComparerMismatch
+	}
+
+	l.compression = Compression(l.root.compression)
+
+	l.wal, err = openWAL(file, opts.syncWrites())
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := l.replayWAL(); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	l.startAutoCompact(opts)
 	return l, nil
 }
 
 // Close closes an initialized Listmap.
 func (l *Listmap) Close() {
+	if l.stopAutoCompact != nil {
+		close(l.stopAutoCompact)
+	}
+	if l.wal != nil {
+		l.Checkpoint()
+		l.wal.close()
+	}
 	syscall.Munmap(l.mapped)
 	l.file.Close()
+	l.closeRetired()
 }
 
 // Destroy closes an initialized Listmap and
-// removes its associated file.
+// removes its associated file, along with its write-ahead log.
 func (l *Listmap) Destroy() {
+	if l.stopAutoCompact != nil {
+		close(l.stopAutoCompact)
+	}
+	if l.wal != nil {
+		l.wal.close()
+		sealed, _ := sealedWALSegments(l.file.Name())
+		for _, n := range sealed {
+			os.Remove(walSegmentPath(l.file.Name(), n))
+		}
+		os.Remove(walPath(l.file.Name()))
+	}
 	syscall.Munmap(l.mapped)
 	l.file.Close()
 	os.Remove(l.file.Name())
+	l.closeRetired()
 }
 
-// Set writes a key-value pair to a Listmap. Records are
-// kept in lexicographical order.
-func (l *Listmap) Set(key, value []byte) error {
-	l.lock.Lock()
-	defer l.lock.Unlock()
+// closeRetired unmaps and, where one was kept, closes every mapping
+// retireMapping has accumulated. It's only safe once the Listmap
+// itself is being closed, since until then a Cursor or Snapshot made
+// before a grow or a Compact may still be reading through one.
+func (l *Listmap) closeRetired() {
+	for _, r := range l.retired {
+		syscall.Munmap(r.mapped)
+		if r.file != nil {
+			r.file.Close()
+		}
+	}
+	l.retired = nil
+}
 
-	if int64(l.root.lastInserted)+constTruncateResize > int64(len(l.mapped)) {
-		syscall.Munmap(l.mapped)
-		err := l.file.Truncate(l.fileSize + constTruncateResize)
-		if err != nil {
-			l.mapped, _ = syscall.Mmap(int(l.file.Fd()), 0, int(l.fileSize),
-				syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
-			l.root = (*root)(unsafe.Pointer(&l.mapped[0]))
+// growIfNeeded truncates the backing file and re-mmaps it if there
+// isn't enough headroom past the physically used space for another
+// record of needed bytes. Growth happens in constTruncateResize
+// chunks, except when needed itself is larger than a single chunk, in
+// which case the file grows by needed so a single large record can't
+// be written past the end of the mapped region.
+func (l *Listmap) growIfNeeded(needed int) error {
+	used := int64(rootLength)
+	if l.root.lastInserted != 0 {
+		last := (*record)(unsafe.Pointer(&l.mapped[l.root.lastInserted]))
+		used = int64(l.root.lastInserted) + int64(recordLength) + int64(last.keylen) + int64(last.vallen)
+	}
+
+	for used+int64(needed) > int64(len(l.mapped)) {
+		growBy := int64(constTruncateResize)
+		if int64(needed) > growBy {
+			growBy = int64(needed)
+		}
+
+		if err := l.file.Truncate(l.fileSize + growBy); err != nil {
 			return ErrFileTruncateError
 		}
-		l.mapped, _ = syscall.Mmap(int(l.file.Fd()), 0, int(l.fileSize+constTruncateResize),
+
+		newMapped, err := syscall.Mmap(int(l.file.Fd()), 0, int(l.fileSize+growBy),
 			syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+
+		// The old mapping is retired rather than unmapped: a Cursor
+		// or Snapshot made before this grow may still be reading
+		// through a pointer into it (see retireMapping).
+		l.retireMapping(nil, l.mapped)
+		l.mapped = newMapped
 		l.root = (*root)(unsafe.Pointer(&l.mapped[0]))
 
-		l.fileSize += constTruncateResize
+		l.fileSize += growBy
+	}
+	return nil
+}
+
+// nextSeq returns the next sequence number, persisting it in the
+// root header. Callers must hold l.lock.
+func (l *Listmap) nextSeq() uint64 {
+	l.root.seq++
+	return l.root.seq
+}
+
+// checkRecordFieldLengths reports ErrKeyTooLarge or ErrValueTooLarge if
+// key or value (which, for a Put, is the value already run through
+// compressValue) won't fit in a record's uint16 keylen/vallen fields.
+func checkRecordFieldLengths(key, value []byte) error {
+	if len(key) > maxRecordFieldLength {
+		return ErrKeyTooLarge
+	}
+	if len(value) > maxRecordFieldLength {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// appendRecord grows the mapped region if necessary and writes a new
+// record for key and value, tagged with seq, to the end of the
+// physically used space. It returns the record's offset. The caller
+// is responsible for linking the record into the ordered list.
+func (l *Listmap) appendRecord(key, value []byte, seq uint64) (int, *record, error) {
+	if err := l.growIfNeeded(int(recordLength) + len(key) + len(value)); err != nil {
+		return 0, nil, err
 	}
 
 	// First record
@@ -154,15 +389,14 @@ func (l *Listmap) Set(key, value []byte) error {
 		r := (*record)(unsafe.Pointer(&l.mapped[rootLength]))
 		r.keylen = uint16(len(key))
 		r.vallen = uint16(len(value))
+		r.seq = seq
 		copy(l.mapped[rootLength+recordLength:], append(key, value...))
 
-		l.root.first = uint64(rootLength)
-		l.root.last = uint64(rootLength)
 		l.root.lastInserted = uint64(rootLength)
-		return nil
+		return int(rootLength), r, nil
 	}
 
-	cursor := l.NewCursor().seek(int(l.root.lastInserted))
+	cursor := l.newCursorLocked().seek(int(l.root.lastInserted))
 
 	// New records always go to the end
 	currentIndex := int(l.root.lastInserted) + int(recordLength) + int(cursor.r.keylen+cursor.r.vallen)
@@ -170,25 +404,81 @@ func (l *Listmap) Set(key, value []byte) error {
 	r := (*record)(unsafe.Pointer(&l.mapped[currentIndex]))
 	r.keylen = uint16(len(key))
 	r.vallen = uint16(len(value))
+	r.seq = seq
 	copy(l.mapped[currentIndex+int(recordLength):], append(key, value...))
 
+	return currentIndex, r, nil
+}
+
+// Set writes a key-value pair to a Listmap. Records are
+// kept in the order of the Listmap's Comparer. If the Listmap was configured with
+// a Compression, value is compressed before being written.
+func (l *Listmap) Set(key, value []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	value = compressValue(l.compression, value)
+	if err := checkRecordFieldLengths(key, value); err != nil {
+		return err
+	}
+	seq := l.nextSeq()
+	if l.wal != nil {
+		if err := l.wal.write(walEntryPut, seq, key, value); err != nil {
+			return err
+		}
+	}
+	return l.setLocked(key, value, seq, false)
+}
+
+// setLocked links a key-value pair, already compressed and assigned
+// seq, into the Listmap. value is assumed to already reflect
+// l.compression; callers that haven't compressed it yet must do so
+// before calling setLocked.
+//
+// replay is set by replayWAL, which re-applies a WAL entry whose
+// effects might already be reflected in the mapped region: in that
+// case the key is already live, and instead of ErrKeyPresent, replay
+// must treat that as success, since it can't distinguish a
+// successfully-applied original Set from one that genuinely failed
+// with ErrKeyPresent (both leave a live record with this key behind,
+// and both are safe no-ops to replay).
+func (l *Listmap) setLocked(key, value []byte, seq uint64, replay bool) error {
+	first := l.root.lastInserted == 0
+
+	currentIndex, r, err := l.appendRecord(key, value, seq)
+	if err != nil {
+		return err
+	}
+	if l.compression != CompressionNone {
+		r.flags |= recordFlagCompressed
+	}
+
+	if first {
+		l.root.first = uint64(currentIndex)
+		l.root.last = uint64(currentIndex)
+		l.noteSampleOp()
+		return nil
+	}
+
 	// Special case: insert at end
-	cursor = cursor.seek(int(l.root.last))
-	lastKey := cursor.Key()
-	if cmp := bytes.Compare(lastKey, key); cmp < 0 || (cmp == 0 && cursor.r.removed) {
+	cursor := l.newCursorLocked().seek(int(l.root.last))
+	lastKey := cursor.keyLocked()
+	if cmp := l.comparer.Compare(lastKey, key); cmp < 0 || (cmp == 0 && cursor.r.isRemoved()) {
 		cursor.r.next = uint64(currentIndex)
 		r.prev = l.root.last
 		l.root.last = cursor.r.next
+		l.noteSampleOp()
 		return nil
 	}
 
 	// Special case: insert at beginning
 	cursor = cursor.seek(int(l.root.first))
-	firstKey := cursor.Key()
-	if cmp := bytes.Compare(firstKey, key); cmp > 0 || (cmp == 0 && cursor.r.removed) {
+	firstKey := cursor.keyLocked()
+	if cmp := l.comparer.Compare(firstKey, key); cmp > 0 || (cmp == 0 && cursor.r.isRemoved()) {
 		cursor.r.prev = uint64(currentIndex)
 		r.next = l.root.first
 		l.root.first = cursor.r.prev
+		l.noteSampleOp()
 		return nil
 	}
 
@@ -196,15 +486,18 @@ func (l *Listmap) Set(key, value []byte) error {
 	cursor = cursor.seek(int(l.root.last))
 
 	for cursor != nil {
-		if bytes.Compare(cursor.Key(), key) == 0 &&
-			!cursor.r.removed {
+		if l.comparer.Compare(cursor.keyLocked(), key) == 0 &&
+			!cursor.r.isRemoved() {
+			if replay {
+				return nil
+			}
 			return ErrKeyPresent
 		}
 
-		if bytes.Compare(cursor.Key(), key) < 0 {
+		if l.comparer.Compare(cursor.keyLocked(), key) < 0 {
 			previousRecord := cursor.r
 			previousRecordIndex := cursor.index
-			nextRecord := cursor.Next().r
+			nextRecord := cursor.nextLocked().r
 			nextRecordIndex := cursor.index
 
 			r.next = uint64(nextRecordIndex)
@@ -213,44 +506,221 @@ func (l *Listmap) Set(key, value []byte) error {
 			previousRecord.next = uint64(currentIndex)
 			nextRecord.prev = uint64(currentIndex)
 
+			l.noteSampleOp()
 			return nil
 		} else {
-			cursor = cursor.Prev()
+			cursor = cursor.prevLocked()
 		}
 	}
 
 	return ErrUnknown
 }
 
+// Write atomically applies the Put and Delete operations buffered in
+// b to the Listmap. Unlike issuing b.Len() individual Set/Remove
+// calls, Write sorts the batch by key once and then walks the
+// ordered list twice: once to validate the whole batch, and once
+// more to merge it in.
+func (l *Listmap) Write(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+
+	ops, err := b.decode(nil)
+	if err != nil {
+		return err
+	}
+
+	// Sort stably, so that operations on the same key stay in their
+	// original batch order, then collapse each run of same-key
+	// operations down to the last one. Without this, the single-pass
+	// merge below only checks a key against records already in the
+	// map before this Write call, never against another op earlier
+	// in the same batch, so e.g. Put("k", v1); Put("k", v2) would
+	// insert two live records for "k" instead of applying only v2.
+	sort.SliceStable(ops, func(i, j int) bool {
+		return l.comparer.Compare(ops[i].key, ops[j].key) < 0
+	})
+	deduped := ops[:0]
+	for i, op := range ops {
+		if i+1 < len(ops) && l.comparer.Compare(ops[i+1].key, op.key) == 0 {
+			continue
+		}
+		deduped = append(deduped, op)
+	}
+	ops = deduped
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	recordAt := func(i uint64) *record {
+		return (*record)(unsafe.Pointer(&l.mapped[i]))
+	}
+	keyAt := func(i uint64, r *record) []byte {
+		start := int(i) + int(recordLength)
+		return l.mapped[start : start+int(r.keylen)]
+	}
+
+	// Validate the whole batch against the current state before
+	// mutating anything. Without this, a conflict or an oversized
+	// key/value discovered partway through the merge loop below would
+	// abort Write after earlier ops in the same batch were already
+	// linked into the list and visible to readers, breaking Write's
+	// documented atomicity. Put values are compressed here and reused
+	// below rather than recomputed.
+	values := make([][]byte, len(ops))
+	for i, cursorIndex := 0, l.root.first; i < len(ops); i++ {
+		op := ops[i]
+		for cursorIndex != 0 {
+			r := recordAt(cursorIndex)
+			if l.comparer.Compare(keyAt(cursorIndex, r), op.key) >= 0 {
+				break
+			}
+			cursorIndex = r.next
+		}
+
+		var match *record
+		for j := cursorIndex; j != 0 && l.comparer.Compare(keyAt(j, recordAt(j)), op.key) == 0; j = recordAt(j).next {
+			if r := recordAt(j); !r.isRemoved() {
+				match = r
+				break
+			}
+		}
+
+		if op.kind == batchRecordDelete {
+			continue
+		}
+
+		if match != nil && !match.isRemoved() {
+			return ErrKeyPresent
+		}
+
+		value := compressValue(l.compression, op.value)
+		if err := checkRecordFieldLengths(op.key, value); err != nil {
+			return err
+		}
+		values[i] = value
+	}
+
+	prevIndex := uint64(0)
+	cursorIndex := l.root.first
+
+	for i, op := range ops {
+		for cursorIndex != 0 {
+			r := recordAt(cursorIndex)
+			if l.comparer.Compare(keyAt(cursorIndex, r), op.key) >= 0 {
+				break
+			}
+			prevIndex = cursorIndex
+			cursorIndex = r.next
+		}
+
+		var match *record
+		for j := cursorIndex; j != 0 && l.comparer.Compare(keyAt(j, recordAt(j)), op.key) == 0; j = recordAt(j).next {
+			if r := recordAt(j); !r.isRemoved() {
+				match = r
+				break
+			}
+		}
+
+		if op.kind == batchRecordDelete {
+			if match != nil {
+				seq := l.nextSeq()
+				if l.wal != nil {
+					if err := l.wal.write(walEntryDelete, seq, op.key, nil); err != nil {
+						return err
+					}
+				}
+				match.removedSeq = seq
+			}
+			continue
+		}
+
+		value := values[i]
+		seq := l.nextSeq()
+		if l.wal != nil {
+			if err := l.wal.write(walEntryPut, seq, op.key, value); err != nil {
+				return err
+			}
+		}
+		newIndex, r, err := l.appendRecord(op.key, value, seq)
+		if err != nil {
+			return err
+		}
+		if l.compression != CompressionNone {
+			r.flags |= recordFlagCompressed
+		}
+
+		r.prev = prevIndex
+		r.next = cursorIndex
+		if prevIndex != 0 {
+			recordAt(prevIndex).next = uint64(newIndex)
+		} else {
+			l.root.first = uint64(newIndex)
+		}
+		if cursorIndex != 0 {
+			recordAt(cursorIndex).prev = uint64(newIndex)
+		} else {
+			l.root.last = uint64(newIndex)
+		}
+
+		prevIndex = uint64(newIndex)
+	}
+
+	l.noteSampleOp()
+	return nil
+}
+
 // Get returns the value in the Listmap associated with key.
 func (l *Listmap) Get(key []byte) ([]byte, error) {
-	for c := l.NewCursor(); c != nil; c = c.Next() {
-		cKey := c.Key()
-		if bytes.Compare(cKey, key) > 0 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for c := l.newCursorLocked(); c != nil; c = c.nextLocked() {
+		cKey := c.keyLocked()
+		if l.comparer.Compare(cKey, key) > 0 {
 			return nil, ErrKeyNotFound
 		}
 
-		if bytes.Compare(cKey, key) == 0 {
-			if !c.r.removed {
-				return c.Value(), nil
+		if l.comparer.Compare(cKey, key) == 0 {
+			if !c.r.isRemoved() {
+				return c.valueLocked(), nil
 			}
 		}
 	}
 	return nil, ErrKeyNotFound
 }
 
-// Remove marks a key as removed
-func (l *Listmap) Remove(key []byte) {
-	for c := l.NewCursor(); c != nil; c = c.Next() {
-		cKey := c.Key()
-		if bytes.Compare(cKey, key) > 0 {
-			return
+// Remove marks a key as removed.
+func (l *Listmap) Remove(key []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	seq := l.nextSeq()
+	if l.wal != nil {
+		if err := l.wal.write(walEntryDelete, seq, key, nil); err != nil {
+			return err
+		}
+	}
+	return l.removeLocked(key, seq, false)
+}
+
+// removeLocked marks key as removed as of seq. replay has the same
+// meaning as in setLocked, though removal is already idempotent: a
+// key that's already removed, or that's missing entirely, is simply
+// left alone either way.
+func (l *Listmap) removeLocked(key []byte, seq uint64, replay bool) error {
+	for c := l.newCursorLocked(); c != nil; c = c.nextLocked() {
+		cKey := c.keyLocked()
+		if l.comparer.Compare(cKey, key) > 0 {
+			return nil
 		}
 
-		if bytes.Compare(cKey, key) == 0 {
-			c.r.removed = true
+		if l.comparer.Compare(cKey, key) == 0 && !c.r.isRemoved() {
+			c.r.removedSeq = seq
 		}
 	}
+	return nil
 }
 
 // Size returns the current file size of the Listmap.
@@ -0,0 +1,55 @@
+package listmap
+
+// Options configures how a Listmap is created or opened. A nil
+// *Options behaves the same as a zero-value &Options{}.
+type Options struct {
+	// Comparer determines the key ordering used by the Listmap. It
+	// defaults to DefaultComparer (lexicographic byte order).
+	Comparer Comparer
+
+	// AutoCompactRatio, if greater than zero, starts a background
+	// goroutine that calls Compact whenever the fraction of dead
+	// bytes (see Stats) reaches this ratio. Zero disables
+	// auto-compaction.
+	AutoCompactRatio float64
+
+	// Compression selects the algorithm used to compress values
+	// before they're written to the Listmap. It defaults to
+	// CompressionNone. Only meaningful for NewListmapWithOptions;
+	// OpenListmapWithOptions restores whichever compression the
+	// file was created with.
+	Compression Compression
+
+	// SyncWrites, if true, fdatasyncs the write-ahead log segment
+	// after every Set, Remove, and Write, at the cost of making
+	// those calls considerably slower. Without it, writes are still
+	// crash-recoverable as of the last Sync or Checkpoint call.
+	SyncWrites bool
+}
+
+// comparer returns the configured Comparer, or DefaultComparer if o
+// is nil or doesn't specify one.
+func (o *Options) comparer() Comparer {
+	if o == nil || o.Comparer == nil {
+		return DefaultComparer
+	}
+	return o.Comparer
+}
+
+// compression returns the configured Compression, or CompressionNone
+// if o is nil.
+func (o *Options) compression() Compression {
+	if o == nil {
+		return CompressionNone
+	}
+	return o.Compression
+}
+
+// syncWrites returns the configured SyncWrites, or false if o is
+// nil.
+func (o *Options) syncWrites() bool {
+	if o == nil {
+		return false
+	}
+	return o.SyncWrites
+}
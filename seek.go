@@ -0,0 +1,284 @@
+package listmap
+
+import "unsafe"
+
+// sampleInterval controls how densely the sampled index tracks keys:
+// roughly every sampleInterval-th record, in list order, gets an
+// entry.
+const sampleInterval = 32
+
+// sampleRebuildOps is how many Sets may happen between automatic
+// sample rebuilds. The sample stays correct indefinitely between
+// rebuilds (existing entries' offsets never move under a Set), but a
+// stale sample degrades Seek back towards a linear scan for keys
+// inserted since the last rebuild.
+const sampleRebuildOps = 256
+
+// sampleEntry is one entry of the in-memory sampled index: the key at
+// a record and that record's offset into l.mapped.
+type sampleEntry struct {
+	key   []byte
+	index uint64
+}
+
+// ensureSample rebuilds the sampled index if it hasn't been built
+// yet, such as right after Open.
+func (l *Listmap) ensureSample() {
+	l.sampleMu.Lock()
+	built := l.sample != nil
+	l.sampleMu.Unlock()
+
+	if !built {
+		l.rebuildSample()
+	}
+}
+
+// rebuildSample walks the list once, in key order, recording every
+// sampleInterval-th key and its offset.
+func (l *Listmap) rebuildSample() {
+	sample := []sampleEntry{}
+
+	i := 0
+	for index := l.root.first; index != 0; {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		if i%sampleInterval == 0 {
+			keyStart := int(index) + int(recordLength)
+			key := append([]byte(nil), l.mapped[keyStart:keyStart+int(r.keylen)]...)
+			sample = append(sample, sampleEntry{key: key, index: index})
+		}
+		i++
+		index = r.next
+	}
+
+	l.sampleMu.Lock()
+	l.sample = sample
+	l.sampleOps = 0
+	l.sampleMu.Unlock()
+}
+
+// noteSampleOp is called after a successful Set or Write to decide
+// whether the sample has drifted enough to be worth refreshing.
+// Callers must hold l.lock.
+func (l *Listmap) noteSampleOp() {
+	l.sampleMu.Lock()
+	l.sampleOps++
+	stale := l.sampleOps >= sampleRebuildOps
+	l.sampleMu.Unlock()
+
+	if stale {
+		l.rebuildSample()
+	}
+}
+
+// invalidateSample discards the sampled index. It must be called
+// whenever record offsets change out from under it, such as after
+// Compact.
+func (l *Listmap) invalidateSample() {
+	l.sampleMu.Lock()
+	l.sample = nil
+	l.sampleOps = 0
+	l.sampleMu.Unlock()
+}
+
+// sampleSearch returns the offset of the closest sampled record whose
+// key is strictly before key, and true, or (0, false) if the sample is
+// empty or no sampled key is before key.
+func (l *Listmap) sampleSearch(key []byte) (uint64, bool) {
+	l.sampleMu.Lock()
+	sample := l.sample
+	l.sampleMu.Unlock()
+
+	lo, hi := 0, len(sample)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if l.comparer.Compare(sample[mid].key, key) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return 0, false
+	}
+	return sample[lo-1].index, true
+}
+
+// Seek repositions the cursor at the first record whose key is
+// greater than or equal to key, according to the Listmap's Comparer,
+// and reports whether such a record exists. Removed records are
+// skipped.
+func (c *Cursor) Seek(key []byte) bool {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	l := c.l
+	l.ensureSample()
+
+	index := l.root.first
+	if start, ok := l.sampleSearch(key); ok {
+		index = start
+	}
+
+	for index != 0 {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		keyStart := int(index) + int(recordLength)
+		k := l.mapped[keyStart : keyStart+int(r.keylen)]
+
+		if l.comparer.Compare(k, key) >= 0 && !r.isRemoved() {
+			c.mapped = l.mapped
+			c.seek(int(index))
+			c.valid = true
+			return true
+		}
+
+		index = r.next
+	}
+
+	c.valid = false
+	return false
+}
+
+// SeekForPrev repositions the cursor at the last record whose key is
+// less than or equal to key, according to the Listmap's Comparer, and
+// reports whether such a record exists. Removed records are skipped.
+func (c *Cursor) SeekForPrev(key []byte) bool {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	l := c.l
+	l.ensureSample()
+
+	start := l.root.first
+	if s, ok := l.sampleSearch(key); ok {
+		start = s
+	}
+	index := start
+
+	var found uint64
+	for index != 0 {
+		r := (*record)(unsafe.Pointer(&l.mapped[index]))
+		keyStart := int(index) + int(recordLength)
+		k := l.mapped[keyStart : keyStart+int(r.keylen)]
+
+		if l.comparer.Compare(k, key) > 0 {
+			break
+		}
+		if !r.isRemoved() {
+			found = index
+		}
+
+		index = r.next
+	}
+
+	// Every record from start up to key is removed: the nearest live
+	// record before start, if any, is the answer.
+	for index = start; found == 0 && index != 0; {
+		index = (*record)(unsafe.Pointer(&l.mapped[index])).prev
+		if index != 0 && !(*record)(unsafe.Pointer(&l.mapped[index])).isRemoved() {
+			found = index
+		}
+	}
+
+	if found == 0 {
+		c.valid = false
+		return false
+	}
+
+	c.mapped = l.mapped
+	c.seek(int(found))
+	c.valid = true
+	return true
+}
+
+// First repositions the cursor at the first record in the Listmap and
+// reports whether one exists.
+func (c *Cursor) First() bool {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	if c.l.root.first == 0 {
+		c.valid = false
+		return false
+	}
+
+	c.mapped = c.l.mapped
+	c.seek(int(c.l.root.first))
+	c.valid = true
+	return true
+}
+
+// Last repositions the cursor at the last record in the Listmap and
+// reports whether one exists.
+func (c *Cursor) Last() bool {
+	c.l.lock.RLock()
+	defer c.l.lock.RUnlock()
+
+	if c.l.root.last == 0 {
+		c.valid = false
+		return false
+	}
+
+	c.mapped = c.l.mapped
+	c.seek(int(c.l.root.last))
+	c.valid = true
+	return true
+}
+
+// Valid reports whether the cursor is currently positioned at a
+// record. Next and Prev also report this via their return value, but
+// Valid lets Seek, SeekForPrev, First, and Last be used in the usual
+// "for c.Seek(k); c.Valid(); c.Next()" iteration style.
+func (c *Cursor) Valid() bool {
+	return c.valid
+}
+
+// RangeCursor iterates over the records whose keys fall in
+// [start, limit), as determined by the Listmap's Comparer.
+type RangeCursor struct {
+	*Cursor
+	limit []byte
+}
+
+// NewRangeCursor returns a RangeCursor positioned at the first record
+// with key >= start, stopping once a key >= limit is reached. A nil
+// start begins at the first record in the Listmap; a nil limit means
+// there is no upper bound.
+func (l *Listmap) NewRangeCursor(start, limit []byte) *RangeCursor {
+	c := l.NewCursor()
+	if c == nil {
+		c = &Cursor{l: l}
+	}
+	if start != nil {
+		c.Seek(start)
+	} else {
+		c.First()
+	}
+
+	rc := &RangeCursor{Cursor: c, limit: limit}
+	rc.checkLimit()
+	return rc
+}
+
+// checkLimit marks the cursor invalid once it has reached or passed
+// limit.
+func (rc *RangeCursor) checkLimit() {
+	if rc.Cursor.valid && rc.limit != nil && rc.Cursor.l.comparer.Compare(rc.Cursor.Key(), rc.limit) >= 0 {
+		rc.Cursor.valid = false
+	}
+}
+
+// Next moves to the next record within the range and reports whether
+// it's still in bounds.
+func (rc *RangeCursor) Next() bool {
+	if !rc.Cursor.valid {
+		return false
+	}
+
+	if rc.Cursor.Next() == nil {
+		rc.Cursor.valid = false
+		return false
+	}
+
+	rc.checkLimit()
+	return rc.Cursor.valid
+}
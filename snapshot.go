@@ -0,0 +1,85 @@
+package listmap
+
+// Snapshot is a consistent, point-in-time view of a Listmap obtained
+// from GetSnapshot. Cursors and Get calls made through a Snapshot
+// only see records that existed at the time it was taken: records
+// inserted afterward, or removed at-or-before it, are skipped.
+type Snapshot struct {
+	l   *Listmap
+	seq uint64
+}
+
+// GetSnapshot returns a Snapshot of the Listmap as of its current
+// sequence number. The Snapshot should be released with Release once
+// it's no longer needed, so Compact can reclaim records that are no
+// longer visible to any live snapshot.
+func (l *Listmap) GetSnapshot() *Snapshot {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	s := &Snapshot{l: l, seq: l.root.seq}
+
+	l.snapshotsMu.Lock()
+	l.snapshots[s.seq]++
+	l.snapshotsMu.Unlock()
+
+	return s
+}
+
+// Release releases the Snapshot. Once released, cursors and Get
+// calls made through it must not be used.
+func (s *Snapshot) Release() {
+	s.l.snapshotsMu.Lock()
+	defer s.l.snapshotsMu.Unlock()
+
+	s.l.snapshots[s.seq]--
+	if s.l.snapshots[s.seq] <= 0 {
+		delete(s.l.snapshots, s.seq)
+	}
+}
+
+// oldestSnapshotSeq returns the sequence number of the oldest live
+// snapshot and true, or (0, false) if there are none.
+func (l *Listmap) oldestSnapshotSeq() (uint64, bool) {
+	l.snapshotsMu.Lock()
+	defer l.snapshotsMu.Unlock()
+
+	oldest, found := uint64(0), false
+	for seq := range l.snapshots {
+		if !found || seq < oldest {
+			oldest = seq
+			found = true
+		}
+	}
+	return oldest, found
+}
+
+// NewCursor returns a pointer to a cursor positioned at the first
+// element visible to the Snapshot, or nil if there isn't one.
+func (s *Snapshot) NewCursor() *Cursor {
+	c := s.l.NewCursor()
+	if c == nil {
+		return nil
+	}
+	c.snapshot = s
+
+	if c.r.visibleAt(s.seq) {
+		return c
+	}
+	return c.Next()
+}
+
+// Get returns the value associated with key as of the Snapshot.
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	for c := s.NewCursor(); c != nil; c = c.Next() {
+		cKey := c.Key()
+		if s.l.comparer.Compare(cKey, key) > 0 {
+			return nil, ErrKeyNotFound
+		}
+
+		if s.l.comparer.Compare(cKey, key) == 0 {
+			return c.Value(), nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
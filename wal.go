@@ -0,0 +1,308 @@
+package listmap
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// walEntryPut and walEntryDelete are the WAL's per-entry types. They
+// share their values with batchRecordPut/batchRecordDelete, since a
+// WAL entry and a batch record describe the same two operations.
+const (
+	walEntryPut    = batchRecordPut
+	walEntryDelete = batchRecordDelete
+)
+
+// walSegmentSizeThreshold is the size, in bytes, a WAL segment may
+// grow to before it's sealed and a new active segment is started.
+const walSegmentSizeThreshold = 4 << 20
+
+// walHeaderLength is the size of a WAL entry frame's header: a
+// 1-byte type and a 4-byte little-endian payload length.
+const walHeaderLength = 1 + 4
+
+// walTrailerLength is the size of a WAL entry frame's trailer: a
+// 4-byte little-endian CRC32 of the payload.
+const walTrailerLength = 4
+
+// ErrWALCorrupted is returned when a WAL segment's contents can't be
+// parsed.
+var ErrWALCorrupted = errors.New("listmap: corrupted WAL segment")
+
+// walEntry is a single decoded WAL record: a Put or Delete tagged
+// with the sequence number it was assigned when it was written.
+type walEntry struct {
+	kind  byte
+	seq   uint64
+	key   []byte
+	value []byte
+}
+
+// wal is an append-only, segmented write-ahead log, modeled on
+// tsm1's WAL. Entries are written to an active segment (<path>.wal)
+// before the corresponding mutation touches the Listmap's mapped
+// region. Once the active segment grows past
+// walSegmentSizeThreshold, it's sealed under a numbered name
+// (<path>.wal.N) and a fresh active segment is opened in its place.
+type wal struct {
+	basePath   string
+	active     *os.File
+	size       int64
+	nextSeal   int
+	syncWrites bool
+}
+
+func walPath(basePath string) string {
+	return basePath + ".wal"
+}
+
+func walSegmentPath(basePath string, n int) string {
+	return walPath(basePath) + "." + strconv.Itoa(n)
+}
+
+// openWAL opens, or creates, the active WAL segment for basePath.
+func openWAL(basePath string, syncWrites bool) (*wal, error) {
+	f, err := os.OpenFile(walPath(basePath), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	sealed, err := sealedWALSegments(basePath)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	nextSeal := 0
+	if len(sealed) > 0 {
+		nextSeal = sealed[len(sealed)-1] + 1
+	}
+
+	return &wal{
+		basePath:   basePath,
+		active:     f,
+		size:       stat.Size(),
+		nextSeal:   nextSeal,
+		syncWrites: syncWrites,
+	}, nil
+}
+
+// sealedWALSegments returns the numeric suffixes of basePath's sealed
+// WAL segments, in ascending (i.e. oldest-first) order.
+func sealedWALSegments(basePath string) ([]int, error) {
+	matches, err := filepath.Glob(walPath(basePath) + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := walPath(basePath) + "."
+	ns := make([]int, 0, len(matches))
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, prefix))
+		if err != nil {
+			continue
+		}
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	return ns, nil
+}
+
+// write appends a single entry to the active segment, rolling to a
+// fresh segment afterwards if it's grown past
+// walSegmentSizeThreshold. If w.syncWrites is set, the active segment
+// is fdatasync'd before write returns.
+func (w *wal) write(kind byte, seq uint64, key, value []byte) error {
+	var seqBuf [8]byte
+	binary.LittleEndian.PutUint64(seqBuf[:], seq)
+
+	payload := append([]byte(nil), seqBuf[:]...)
+	payload = appendUvarintBytes(payload, key)
+	if kind == walEntryPut {
+		payload = appendUvarintBytes(payload, value)
+	}
+
+	frame := make([]byte, 0, walHeaderLength+len(payload)+walTrailerLength)
+	frame = append(frame, kind)
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	frame = append(frame, lenBuf[:]...)
+	frame = append(frame, payload...)
+	var crcBuf [4]byte
+	binary.LittleEndian.PutUint32(crcBuf[:], crc32.ChecksumIEEE(payload))
+	frame = append(frame, crcBuf[:]...)
+
+	if _, err := w.active.Write(frame); err != nil {
+		return err
+	}
+	w.size += int64(len(frame))
+
+	if w.syncWrites {
+		if err := fdatasync(w.active); err != nil {
+			return err
+		}
+	}
+
+	if w.size >= walSegmentSizeThreshold {
+		return w.roll()
+	}
+	return nil
+}
+
+// roll seals the active segment under a numbered name and opens a
+// fresh, empty active segment in its place.
+func (w *wal) roll() error {
+	if err := w.active.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(walPath(w.basePath), walSegmentPath(w.basePath, w.nextSeal)); err != nil {
+		return err
+	}
+	w.nextSeal++
+
+	f, err := os.OpenFile(walPath(w.basePath), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w.active = f
+	w.size = 0
+	return nil
+}
+
+// sync fdatasyncs the active segment.
+func (w *wal) sync() error {
+	return fdatasync(w.active)
+}
+
+// truncate discards every segment, sealed or active, and starts a
+// fresh, empty active segment. It's called once the Listmap's mapped
+// region is known to already reflect every entry written so far.
+func (w *wal) truncate() error {
+	sealed, err := sealedWALSegments(w.basePath)
+	if err != nil {
+		return err
+	}
+	for _, n := range sealed {
+		if err := os.Remove(walSegmentPath(w.basePath, n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := w.active.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(walPath(w.basePath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(walPath(w.basePath), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w.active = f
+	w.size = 0
+	w.nextSeal = 0
+	return nil
+}
+
+// close closes the active segment without removing anything.
+func (w *wal) close() error {
+	return w.active.Close()
+}
+
+// readWAL returns every entry logged across all of basePath's
+// segments, sealed and active, in the order they were originally
+// written.
+func readWAL(basePath string) ([]walEntry, error) {
+	var entries []walEntry
+
+	sealed, err := sealedWALSegments(basePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range sealed {
+		es, err := readWALSegment(walSegmentPath(basePath, n))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, es...)
+	}
+
+	es, err := readWALSegment(walPath(basePath))
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, es...)
+
+	return entries, nil
+}
+
+// readWALSegment decodes every entry from a single WAL segment file.
+// A truncated trailing frame, which a crash mid-append would leave
+// behind, ends decoding early rather than returning an error: an
+// incomplete frame was never acknowledged to a caller, so it's safe
+// to drop. A length-complete frame whose CRC doesn't match, on the
+// other hand, indicates real corruption rather than a crash mid-write
+// and is reported as ErrWALCorrupted.
+func readWALSegment(path string) ([]walEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []walEntry
+	for len(data) >= walHeaderLength {
+		kind := data[0]
+		length := binary.LittleEndian.Uint32(data[1:walHeaderLength])
+		frameLen := walHeaderLength + int(length) + walTrailerLength
+		if len(data) < frameLen {
+			break
+		}
+
+		payload := data[walHeaderLength : walHeaderLength+int(length)]
+		wantCRC := binary.LittleEndian.Uint32(data[walHeaderLength+int(length) : frameLen])
+		if crc32.ChecksumIEEE(payload) != wantCRC {
+			return nil, ErrWALCorrupted
+		}
+		if len(payload) < 8 {
+			return nil, ErrWALCorrupted
+		}
+
+		seq := binary.LittleEndian.Uint64(payload[0:8])
+		key, rest, err := readUvarintBytes(payload[8:])
+		if err != nil {
+			return nil, err
+		}
+
+		entry := walEntry{kind: kind, seq: seq, key: key}
+		if kind == walEntryPut {
+			value, _, err := readUvarintBytes(rest)
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		}
+
+		entries = append(entries, entry)
+		data = data[frameLen:]
+	}
+
+	return entries, nil
+}
+
+// fdatasync flushes f's data, though not necessarily its metadata,
+// to disk.
+func fdatasync(f *os.File) error {
+	return syscall.Fdatasync(int(f.Fd()))
+}